@@ -0,0 +1,52 @@
+package blockstore
+
+import (
+	"os"
+	"testing"
+
+	"github.com/DSiSc/blockstore/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// test the BlockStore write/read/delete cycle against every DBStore plugin
+func TestBlockStore_Backends(t *testing.T) {
+	backends := []struct {
+		name       string
+		pluginName string
+		dataPath   string
+	}{
+		{name: "memorydb", pluginName: PLUGIN_MEMDB, dataPath: "./testdata-memorydb"},
+		{name: "leveldb", pluginName: PLUGIN_LEVELDB, dataPath: "./testdata-leveldb"},
+		{name: "pebble", pluginName: PLUGIN_PEBBLE, dataPath: "./testdata-pebble"},
+	}
+
+	for _, backend := range backends {
+		backend := backend
+		t.Run(backend.name, func(t *testing.T) {
+			assert := assert.New(t)
+			defer os.RemoveAll(backend.dataPath)
+
+			blockStore, err := NewBlockStore(&config.BlockStoreConfig{
+				PluginName: backend.pluginName,
+				DataPath:   backend.dataPath,
+			})
+			assert.Nil(err)
+			assert.NotNil(blockStore)
+
+			block := mockBlock()
+			assert.Nil(blockStore.WriteBlock(block))
+
+			blockSaved, err := blockStore.GetBlockByHash(block.HeaderHash)
+			assert.Nil(err)
+			assert.Equal(block.HeaderHash, blockSaved.HeaderHash)
+
+			blockByHeight, err := blockStore.GetBlockByHeight(block.Header.Height)
+			assert.Nil(err)
+			assert.Equal(block.HeaderHash, blockByHeight.HeaderHash)
+
+			assert.Nil(blockStore.DeleteBlock(block.HeaderHash))
+			_, err = blockStore.GetBlockByHash(block.HeaderHash)
+			assert.NotNil(err)
+		})
+	}
+}
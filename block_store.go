@@ -8,9 +8,11 @@ import (
 	"github.com/DSiSc/blockstore/config"
 	"github.com/DSiSc/blockstore/leveldbstore"
 	"github.com/DSiSc/blockstore/memorystore"
+	"github.com/DSiSc/blockstore/pebblestore"
 	"github.com/DSiSc/blockstore/util"
 	"github.com/DSiSc/craft/log"
 	"github.com/DSiSc/craft/types"
+	lru "github.com/hashicorp/golang-lru"
 	"sync"
 	"sync/atomic"
 )
@@ -20,6 +22,8 @@ const (
 	PLUGIN_LEVELDB = "leveldb"
 	// memory plugin
 	PLUGIN_MEMDB = "memorydb"
+	// pebble plugin
+	PLUGIN_PEBBLE = "pebble"
 	// block height before genesis block
 	INIT_BLOCK_HEIGHT = 0
 	// latestBlockKey tracks the latest know full block's hash.
@@ -31,13 +35,31 @@ type DBStore interface {
 	Put(key []byte, value []byte) error
 	Get(key []byte) ([]byte, error)
 	Delete(key []byte) error
+	// NewBatch returns a WriteBatch that stages Put/Delete operations and
+	// commits them to the store atomically on Write.
+	NewBatch() common.WriteBatch
 }
 
+// WriteBatch is the batch type staged operations are written through; it is
+// an alias of common.WriteBatch, the type the store plugins implement, so
+// callers in this package can use the short name.
+type WriteBatch = common.WriteBatch
+
 // Block store save the data of block & transaction
 type BlockStore struct {
-	store        DBStore      // Block store handler
-	currentBlock atomic.Value //Current block
-	lock         sync.RWMutex
+	store          DBStore      // Block store handler
+	codec          BlockCodec   // Block encode/decode strategy
+	txIndexEnabled bool         // Whether the tx-lookup index is maintained
+	currentBlock   atomic.Value //Current block
+	lock           sync.RWMutex
+
+	blockCache  *lru.Cache // Recently used full blocks, keyed by hash
+	headerCache *lru.Cache // Recently used headers, keyed by hash
+
+	blockCacheHits    uint64
+	blockCacheMisses  uint64
+	headerCacheHits   uint64
+	headerCacheMisses uint64
 }
 
 // NewBlockStore return the block store instance
@@ -47,15 +69,50 @@ func NewBlockStore(config *config.BlockStoreConfig) (*BlockStore, error) {
 	if err != nil {
 		return nil, err
 	}
+	codec, err := newBlockCodec(config.Codec)
+	if err != nil {
+		return nil, err
+	}
+	blockCache, headerCache, err := newCaches(config.BlockCacheSize, config.HeaderCacheSize)
+	if err != nil {
+		return nil, err
+	}
 	blockStore := &BlockStore{
-		store: store,
+		store:          store,
+		codec:          codec,
+		txIndexEnabled: config.EnableTxIndex,
+		blockCache:     blockCache,
+		headerCache:    headerCache,
 	}
 
+	//migrate any legacy, untagged records to the current key schema.
+	blockStore.migrateLegacySchema()
+	//ensure the store's codec matches the one it was created with.
+	if err := blockStore.checkCodec(); err != nil {
+		return nil, err
+	}
 	//load latest block from database.
 	blockStore.loadLatestBlock()
 	return blockStore, nil
 }
 
+// checkCodec persists the active codec name the first time a store is
+// opened, and fails cleanly if a store previously created with a different
+// codec is reopened with a mismatched one.
+func (blockStore *BlockStore) checkCodec() error {
+	codecName, err := blockStore.store.Get(metaCodecKey)
+	if err != nil {
+		if err := blockStore.store.Put(metaCodecKey, []byte(codecNameOf(blockStore.codec))); err != nil {
+			log.Warn("Failed to record active codec, as: %v ", err)
+		}
+		return nil
+	}
+	if string(codecName) != codecNameOf(blockStore.codec) {
+		return fmt.Errorf("store was created with codec %q, cannot open it with codec %q", codecName, codecNameOf(blockStore.codec))
+	}
+	return nil
+}
+
 // init db store.
 func createDBStore(config *config.BlockStoreConfig) (DBStore, error) {
 	switch config.PluginName {
@@ -65,16 +122,92 @@ func createDBStore(config *config.BlockStoreConfig) (DBStore, error) {
 	case PLUGIN_MEMDB:
 		log.Debug("Create memory-based block store")
 		return memorystore.NewMemDBStore(), nil
+	case PLUGIN_PEBBLE:
+		log.Debug("Create pebble-based block store, with file path: %s ", config.DataPath)
+		return pebblestore.NewPebbleStore(config.DataPath, pebblestore.Options{
+			CacheSize:    config.PebbleCacheSize,
+			MaxOpenFiles: config.PebbleMaxOpenFiles,
+			WALSync:      config.PebbleWALSync,
+		})
 	default:
 		log.Error("Not support plugin.")
 		return nil, fmt.Errorf("Not support plugin type %s", config.PluginName)
 	}
 }
 
+// migrateLegacySchema detects records written under the old ad-hoc key
+// scheme (bare hash as key, bare 8-byte height as key, the string
+// "LatestBlock") and rewrites them under the tagged schema defined in
+// keys.go. Legacy bodies are always JSON, so they are decoded and re-encoded
+// with blockStore.codec rather than copied verbatim, since a store opened
+// with a non-JSON codec would otherwise fail to decode them on first read.
+// Each migrated block also gets a header entry staged alongside its body, so
+// header-only reads work for pre-existing chain history after an upgrade.
+// It is gated by metaSchemaVersionKey so the rewrite runs exactly once per
+// store.
+func (blockStore *BlockStore) migrateLegacySchema() {
+	if _, err := blockStore.store.Get(metaSchemaVersionKey); err == nil {
+		// already migrated (or created fresh under the current schema)
+		return
+	}
+
+	legacyHashByte, err := blockStore.store.Get(legacyLatestBlockKey)
+	if err != nil {
+		log.Debug("No legacy latest block record found, nothing to migrate")
+	} else {
+		log.Info("Legacy key schema detected, migrating records to the tagged schema")
+		batch := blockStore.store.NewBatch()
+		defer batch.Close()
+
+		hash := util.BytesToHash(legacyHashByte)
+		migrated := 0
+		for {
+			legacyBlockByte, err := blockStore.store.Get(util.HashToBytes(hash))
+			if err != nil {
+				break
+			}
+			block, err := decodeBlock(legacyBlockByte)
+			if err != nil {
+				log.Warn("Failed to decode legacy block %s during migration, stopping walk back, as: %v ", hash, err)
+				break
+			}
+			blockByte, err := blockStore.codec.Encode(block)
+			if err != nil {
+				log.Warn("Failed to re-encode legacy block %s with the active codec, stopping walk back, as: %v ", hash, err)
+				break
+			}
+			batch.Put(blockBodyKey(util.HashToBytes(hash)), blockByte)
+			if err := blockStore.stageHeaderNoLock(batch, block); err != nil {
+				log.Warn("Failed to stage header for legacy block %s, stopping walk back, as: %v ", hash, err)
+				break
+			}
+			hashesByte, err := encodeHashList([]types.Hash{hash})
+			if err == nil {
+				batch.Put(heightIndexKey(block.Header.Height), hashesByte)
+			}
+			batch.Delete(util.HashToBytes(hash))
+			batch.Delete(encodeBlockHeight(block.Header.Height))
+			migrated++
+			hash = block.Header.PrevBlockHash
+		}
+		batch.Put(latestBlockMetaKey, legacyHashByte)
+		batch.Delete(legacyLatestBlockKey)
+		if err := batch.Write(); err != nil {
+			log.Error("Failed to migrate legacy records to the tagged schema, as: %v ", err)
+			return
+		}
+		log.Info("Migrated %d legacy block record(s) to the tagged schema", migrated)
+	}
+
+	if err := blockStore.store.Put(metaSchemaVersionKey, encodeBlockHeight(schemaVersion)); err != nil {
+		log.Warn("Failed to record schema version after migration, as: %v ", err)
+	}
+}
+
 // load latest block from database.
 func (blockStore *BlockStore) loadLatestBlock() {
 	log.Info("Start loading block from database")
-	blockHashByte, err := blockStore.store.Get([]byte(latestBlockKey))
+	blockHashByte, err := blockStore.store.Get(latestBlockMetaKey)
 	if err != nil {
 		log.Warn("Failed to load latest block hash from database, we will set current block to nil")
 		return
@@ -93,55 +226,268 @@ func (blockStore *BlockStore) loadLatestBlock() {
 // WriteBlock write the block to database. return error if write failed.
 func (blockStore *BlockStore) WriteBlock(block *types.Block) error {
 	log.Info("Start writing block %v to database.", block)
-	blockByte, err := encodeBlock(block)
+	blockStore.lock.Lock()
+	defer blockStore.lock.Unlock()
+
+	batch := blockStore.store.NewBatch()
+	defer batch.Close()
+	if err := blockStore.stageBlockNoLock(batch, block, make(map[uint64][]types.Hash)); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		log.Error("Failed to write block %v to database, as: %v ", block, err)
+		return fmt.Errorf("failed to write block %v to database, as: %v ", block, err)
+	}
+	// update current block
+	blockStore.recordCurrentBlock(block)
+	return nil
+}
+
+// WriteBlocks writes an entire range of blocks in a single batch commit,
+// useful for initial sync / fast import where per-block fsync dominates cost.
+func (blockStore *BlockStore) WriteBlocks(blocks []*types.Block) error {
+	log.Info("Start writing %d blocks to database.", len(blocks))
+	blockStore.lock.Lock()
+	defer blockStore.lock.Unlock()
+
+	batch := blockStore.store.NewBatch()
+	defer batch.Close()
+	// shared across every block in this call, so two blocks at the same
+	// height both land in the staged height-index entry instead of the
+	// second one's Put silently overwriting the first's in the batch.
+	pendingHeightIndex := make(map[uint64][]types.Hash)
+	for _, block := range blocks {
+		if err := blockStore.stageBlockNoLock(batch, block, pendingHeightIndex); err != nil {
+			return err
+		}
+	}
+	if err := batch.Write(); err != nil {
+		log.Error("Failed to write %d blocks to database, as: %v ", len(blocks), err)
+		return fmt.Errorf("failed to write %d blocks to database, as: %v ", len(blocks), err)
+	}
+	if len(blocks) > 0 {
+		blockStore.recordCurrentBlock(blocks[len(blocks)-1])
+	}
+	return nil
+}
+
+// syncTxHashKeys copies the runtime Hash cache of every transaction that has
+// one computed into TxData.Hash, the field a BlockCodec actually carries
+// through encode/decode; types.Transaction.Hash is a sync/atomic.Value with
+// no exported state of its own, so it does not survive being marshaled.
+func syncTxHashKeys(block *types.Block) {
+	for _, tx := range block.Transactions {
+		if hash, ok := tx.Hash.Load().(types.Hash); ok {
+			tx.Data.Hash = &hash
+		}
+	}
+}
+
+// restoreTxHashCaches re-primes the runtime Hash cache of every transaction
+// in block from its persisted TxData.Hash, the inverse of syncTxHashKeys, so
+// a block read back from the store behaves like one freshly written.
+func restoreTxHashCaches(block *types.Block) {
+	for _, tx := range block.Transactions {
+		if tx.Data.Hash != nil {
+			tx.Hash.Store(*tx.Data.Hash)
+		}
+	}
+}
+
+// stageBlockNoLock stages the block payload, height index and latest block
+// pointer writes for block into batch. pendingHeightIndex accumulates the
+// height-index candidates staged so far across the whole WriteBlock(s) call,
+// so that writing several blocks sharing a height in one batch doesn't lose
+// all but the last one's hash to the batch only keeping its final Put per
+// key. Callers must hold blockStore.lock.
+func (blockStore *BlockStore) stageBlockNoLock(batch common.WriteBatch, block *types.Block, pendingHeightIndex map[uint64][]types.Hash) error {
+	syncTxHashKeys(block)
+	blockByte, err := blockStore.codec.Encode(block)
 	if err != nil {
 		log.Error("Failed to encode block %v to byte, as: %v ", block, err)
 		return fmt.Errorf("Failed to encode block %v to byte, as: %v ", block, err)
 	}
-	// write block
 	blockHash := common.BlockHash(block)
-	err = blockStore.store.Put(util.HashToBytes(blockHash), blockByte)
-	if err != nil {
-		log.Error("Failed to write block %s to database, as: %v ", blockHash, err)
-		return fmt.Errorf("Failed to write block %s to database, as: %v ", blockHash, err)
+	batch.Put(blockBodyKey(util.HashToBytes(blockHash)), blockByte)
+
+	// append the hash to the candidate list for this height, since forks mean
+	// a height is not necessarily mapped to a single block.
+	hashes, ok := pendingHeightIndex[block.Header.Height]
+	if !ok {
+		hashes, err = blockStore.getBlockHashesByHeightNoLock(block.Header.Height)
+		if err != nil {
+			hashes = nil
+		}
 	}
-	// write block height and hash mapping
-	err = blockStore.store.Put(encodeBlockHeight(block.Header.Height), util.HashToBytes(blockHash))
+	hashes = appendHashIfAbsent(hashes, blockHash)
+	pendingHeightIndex[block.Header.Height] = hashes
+	hashesByte, err := encodeHashList(hashes)
 	if err != nil {
-		log.Error("Failed to record the mapping between block and height")
-		return fmt.Errorf("Failed to record the mapping between block and height ")
+		log.Error("Failed to encode height index for height %d, as: %v ", block.Header.Height, err)
+		return fmt.Errorf("Failed to encode height index for height %d, as: %v ", block.Header.Height, err)
 	}
-	// update current block
-	blockStore.recordCurrentBlock(block)
-	// update latest block
-	err = blockStore.store.Put([]byte(latestBlockKey), util.HashToBytes(blockHash))
+	batch.Put(heightIndexKey(block.Header.Height), hashesByte)
+	batch.Put(latestBlockMetaKey, util.HashToBytes(blockHash))
+
+	if err := blockStore.stageHeaderNoLock(batch, block); err != nil {
+		return err
+	}
+	blockStore.invalidateCaches(blockHash)
+
+	if blockStore.txIndexEnabled {
+		if err := blockStore.stageTxIndexNoLock(batch, block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteBlock removes the block identified by hash, along with its height
+// index entry. If the deleted block is the current tip, the tip is rolled
+// back to its parent via Header.PrevBlockHash so callers can re-apply an
+// alternate branch after a reorg.
+func (blockStore *BlockStore) DeleteBlock(hash types.Hash) error {
+	log.Info("Start deleting block %s from database.", hash)
+	blockStore.lock.Lock()
+	defer blockStore.lock.Unlock()
+
+	block, err := blockStore.getBlockByHashNoLock(hash)
 	if err != nil {
-		log.Warn("Failed to record latest block, as: %v. we will still use the previous latest block as current latest block ", err)
+		log.Error("Failed to get block %s to delete, as: %v ", hash, err)
+		return fmt.Errorf("failed to get block %s to delete, as: %v ", hash, err)
+	}
+
+	batch := blockStore.store.NewBatch()
+	defer batch.Close()
+
+	// remove the block payload
+	batch.Delete(blockBodyKey(util.HashToBytes(hash)))
+	batch.Delete(blockHeaderKey(util.HashToBytes(hash)))
+	blockStore.invalidateCaches(hash)
+
+	if blockStore.txIndexEnabled {
+		blockStore.unstageTxIndexNoLock(batch, block)
+	}
+
+	// remove the hash from the height index, dropping the key entirely once empty
+	hashes, err := blockStore.getBlockHashesByHeightNoLock(block.Header.Height)
+	if err == nil {
+		hashes = removeHash(hashes, hash)
+		if len(hashes) == 0 {
+			batch.Delete(heightIndexKey(block.Header.Height))
+		} else {
+			hashesByte, err := encodeHashList(hashes)
+			if err != nil {
+				log.Error("Failed to encode height index for height %d, as: %v ", block.Header.Height, err)
+				return fmt.Errorf("failed to encode height index for height %d, as: %v ", block.Header.Height, err)
+			}
+			batch.Put(heightIndexKey(block.Header.Height), hashesByte)
+		}
+	}
+
+	// roll the tip back to the parent block when the deleted block was current
+	current := blockStore.GetCurrentBlock()
+	rollbackToParent := current != nil && common.BlockHash(current) == hash
+	var parent *types.Block
+	if rollbackToParent {
+		parentHash := block.Header.PrevBlockHash
+		parent, err = blockStore.getBlockByHashNoLock(parentHash)
+		if err != nil {
+			log.Warn("Parent block %s not found after deleting tip %s, clearing current block", parentHash, hash)
+			batch.Delete(latestBlockMetaKey)
+		} else {
+			batch.Put(latestBlockMetaKey, util.HashToBytes(parentHash))
+		}
+	}
+
+	if err := batch.Write(); err != nil {
+		log.Error("Failed to delete block %s from database, as: %v ", hash, err)
+		return fmt.Errorf("failed to delete block %s from database, as: %v ", hash, err)
+	}
+
+	if rollbackToParent {
+		if parent != nil {
+			blockStore.recordCurrentBlock(parent)
+		} else {
+			// Store a typed nil rather than reassigning currentBlock itself:
+			// atomic.Value's own concurrency guarantees only cover Store/Load,
+			// and GetCurrentBlock reads currentBlock without taking lock.
+			blockStore.currentBlock.Store((*types.Block)(nil))
+		}
 	}
 	return nil
 }
 
+// DeleteBlocksFromHeight rolls the chain back by repeatedly deleting the
+// current tip until its height drops below h, the bulk counterpart to
+// DeleteBlock used to undo a range of blocks during a reorg.
+func (blockStore *BlockStore) DeleteBlocksFromHeight(h uint64) error {
+	for {
+		current := blockStore.GetCurrentBlock()
+		if current == nil || current.Header.Height < h {
+			return nil
+		}
+		if err := blockStore.DeleteBlock(common.BlockHash(current)); err != nil {
+			return err
+		}
+	}
+}
+
+// GetBlockHashesByHeight returns every candidate block hash recorded at the
+// given height. Because forks can share a height, more than one hash may be
+// returned.
+func (blockStore *BlockStore) GetBlockHashesByHeight(h uint64) ([]types.Hash, error) {
+	blockStore.lock.RLock()
+	defer blockStore.lock.RUnlock()
+	return blockStore.getBlockHashesByHeightNoLock(h)
+}
+
+// getBlockHashesByHeightNoLock is the lock-free core of GetBlockHashesByHeight.
+func (blockStore *BlockStore) getBlockHashesByHeightNoLock(h uint64) ([]types.Hash, error) {
+	hashesByte, err := blockStore.store.Get(heightIndexKey(h))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block hashes with height %d, as: %s", h, err)
+	}
+	return decodeHashList(hashesByte)
+}
+
 // GetBlockByHash get block by block hash.
 func (blockStore *BlockStore) GetBlockByHash(hash types.Hash) (*types.Block, error) {
-	blockByte, err := blockStore.store.Get(util.HashToBytes(hash))
+	blockStore.lock.RLock()
+	defer blockStore.lock.RUnlock()
+	return blockStore.getBlockByHashNoLock(hash)
+}
+
+// getBlockByHashNoLock is the lock-free core of GetBlockByHash.
+func (blockStore *BlockStore) getBlockByHashNoLock(hash types.Hash) (*types.Block, error) {
+	if cached, ok := blockStore.blockCache.Get(hash); ok {
+		atomic.AddUint64(&blockStore.blockCacheHits, 1)
+		return cached.(*types.Block), nil
+	}
+	atomic.AddUint64(&blockStore.blockCacheMisses, 1)
+
+	blockByte, err := blockStore.store.Get(blockBodyKey(util.HashToBytes(hash)))
 	if blockByte == nil || err != nil {
 		return nil, fmt.Errorf("failed to get block with hash %s, as: %s", hash, err)
 	}
-	block, err := decodeBlock(blockByte)
+	block, err := blockStore.codec.Decode(blockByte)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode block with hash %s from database as: %s", hash, err)
 	}
+	restoreTxHashCaches(block)
+	blockStore.blockCache.Add(hash, block)
 	return block, nil
 }
 
-// GetBlockByHeight get block by height.
+// GetBlockByHeight get block by height. When a height carries more than one
+// candidate block because of a fork, the most recently written one is
+// returned as the canonical block for that height.
 func (blockStore *BlockStore) GetBlockByHeight(height uint64) (*types.Block, error) {
-	blockHashByte, err := blockStore.store.Get(encodeBlockHeight(height))
-	if err != nil {
+	hashes, err := blockStore.GetBlockHashesByHeight(height)
+	if err != nil || len(hashes) == 0 {
 		return nil, fmt.Errorf("failed to get block with height %d, as: %s", height, err)
 	}
-	blockHash := util.BytesToHash(blockHashByte)
-	return blockStore.GetBlockByHash(blockHash)
+	return blockStore.GetBlockByHash(hashes[len(hashes)-1])
 }
 
 // GetCurrentBlock get current block.
@@ -192,3 +538,38 @@ func decodeBlock(blockByte []byte) (*types.Block, error) {
 		return block, nil
 	}
 }
+
+// encodeHashList encodes the list of candidate hashes stored at a height index entry.
+func encodeHashList(hashes []types.Hash) ([]byte, error) {
+	return json.Marshal(hashes)
+}
+
+// decodeHashList decodes the list of candidate hashes stored at a height index entry.
+func decodeHashList(hashesByte []byte) ([]types.Hash, error) {
+	var hashes []types.Hash
+	if err := json.Unmarshal(hashesByte, &hashes); err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// appendHashIfAbsent appends hash to hashes unless it is already present.
+func appendHashIfAbsent(hashes []types.Hash, hash types.Hash) []types.Hash {
+	for _, h := range hashes {
+		if h == hash {
+			return hashes
+		}
+	}
+	return append(hashes, hash)
+}
+
+// removeHash returns hashes with hash removed, preserving order.
+func removeHash(hashes []types.Hash, hash types.Hash) []types.Hash {
+	result := hashes[:0]
+	for _, h := range hashes {
+		if h != hash {
+			result = append(result, h)
+		}
+	}
+	return result
+}
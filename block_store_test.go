@@ -3,6 +3,7 @@ package blockstore
 import (
 	"github.com/DSiSc/blockstore/common"
 	"github.com/DSiSc/blockstore/config"
+	"github.com/DSiSc/blockstore/memorystore"
 	"github.com/DSiSc/blockstore/util"
 	"github.com/DSiSc/craft/types"
 	"github.com/golang/mock/gomock"
@@ -12,8 +13,11 @@ import (
 )
 
 var (
-	stateHash = util.HexToHash("0x5a0b54d5dc17e0aadc383d2db43b0a0d3e029c4c")
-	blockHash = util.HexToHash("0xb3f9a62087cbe321e798966883cbc445d9b924a9bbf2e010957a537ea2da7f02")
+	stateHash   = util.HexToHash("0x5a0b54d5dc17e0aadc383d2db43b0a0d3e029c4c")
+	blockHash   = util.HexToHash("0xb3f9a62087cbe321e798966883cbc445d9b924a9bbf2e010957a537ea2da7f02")
+	childHash   = util.HexToHash("0xc4fab63198dcf432e809a77994dcd556eac05b5bccf3121068646c48fb3e813")
+	txHash      = util.HexToHash("0x9a1b2c3d4e5f60718293a4b5c6d7e8f901234567890abcdef1234567890abcd")
+	siblingHash = util.HexToHash("0xd5fb74421a9ef854f91b88ab05edf667fbd16c6ddf0232179757d59fc4f924")
 )
 
 type MockBlock struct {
@@ -42,6 +46,20 @@ func mockBlock() *types.Block {
 	return block
 }
 
+// mock a single transaction
+func mockTransaction() *types.Transaction {
+	tx := &types.Transaction{}
+	tx.Hash.Store(txHash)
+	return tx
+}
+
+// mock a block carrying a single transaction
+func mockBlockWithTransaction() *types.Block {
+	block := mockBlock()
+	block.Transactions = []*types.Transaction{mockTransaction()}
+	return block
+}
+
 // test create block store
 func TestNewBlockStore(t *testing.T) {
 	assert := assert.New(t)
@@ -75,6 +93,45 @@ func TestBlockStore_WriteBlock(t *testing.T) {
 	assert.Nil(err)
 }
 
+// test write a range of blocks in a single batch
+func TestBlockStore_WriteBlocks(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(err)
+	assert.NotNil(blockStore)
+
+	genesis := mockBlock()
+	child := mockChainedBlock(2, genesis.HeaderHash)
+	err = blockStore.WriteBlocks([]*types.Block{genesis, child})
+	assert.Nil(err)
+
+	current := blockStore.GetCurrentBlock()
+	assert.Equal(child.HeaderHash, current.HeaderHash)
+	blockSaved, err := blockStore.GetBlockByHash(genesis.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(genesis.HeaderHash, blockSaved.HeaderHash)
+}
+
+// test that two blocks forking at the same height, written via a single
+// WriteBlocks call, both end up as candidates in the height index rather
+// than the second one's batch Put silently dropping the first
+func TestBlockStore_WriteBlocks_SharedHeight(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(err)
+	assert.NotNil(blockStore)
+
+	genesis := mockBlock()
+	sibling := mockChainedBlock(genesis.Header.Height, genesis.HeaderHash)
+	sibling.HeaderHash = siblingHash
+	err = blockStore.WriteBlocks([]*types.Block{genesis, sibling})
+	assert.Nil(err)
+
+	hashes, err := blockStore.GetBlockHashesByHeight(genesis.Header.Height)
+	assert.Nil(err)
+	assert.ElementsMatch([]types.Hash{genesis.HeaderHash, sibling.HeaderHash}, hashes)
+}
+
 // test get block by hash
 func TestBlockStore_GetBlockByHash(t *testing.T) {
 	assert := assert.New(t)
@@ -119,6 +176,263 @@ func TestBlockStore_GetCurrentBlock(t *testing.T) {
 	assert.Equal(block.HeaderHash, blockCurrent.HeaderHash)
 }
 
+// mock a block at the given height, chained to parentHash
+func mockChainedBlock(height uint64, parentHash types.Hash) *types.Block {
+	header := types.Header{
+		Height:        height,
+		StateRoot:     stateHash,
+		PrevBlockHash: parentHash,
+	}
+	block := &types.Block{
+		Header:     &header,
+		HeaderHash: childHash,
+	}
+	return block
+}
+
+// test delete block rolls the tip back to the parent block
+func TestBlockStore_DeleteBlock(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(err)
+	assert.NotNil(blockStore)
+
+	genesis := mockBlock()
+	assert.Nil(blockStore.WriteBlock(genesis))
+	child := mockChainedBlock(2, genesis.HeaderHash)
+	assert.Nil(blockStore.WriteBlock(child))
+
+	err = blockStore.DeleteBlock(child.HeaderHash)
+	assert.Nil(err)
+	current := blockStore.GetCurrentBlock()
+	assert.Equal(genesis.HeaderHash, current.HeaderHash)
+
+	_, err = blockStore.GetBlockByHash(child.HeaderHash)
+	assert.NotNil(err)
+}
+
+// test deleting a range of blocks via DeleteBlocksFromHeight
+func TestBlockStore_DeleteBlocksFromHeight(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(err)
+	assert.NotNil(blockStore)
+
+	genesis := mockBlock()
+	assert.Nil(blockStore.WriteBlock(genesis))
+	child := mockChainedBlock(2, genesis.HeaderHash)
+	assert.Nil(blockStore.WriteBlock(child))
+
+	err = blockStore.DeleteBlocksFromHeight(2)
+	assert.Nil(err)
+	current := blockStore.GetCurrentBlock()
+	assert.Equal(genesis.HeaderHash, current.HeaderHash)
+}
+
+// test get block hashes by height
+func TestBlockStore_GetBlockHashesByHeight(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(err)
+	assert.NotNil(blockStore)
+
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+
+	hashes, err := blockStore.GetBlockHashesByHeight(block.Header.Height)
+	assert.Nil(err)
+	assert.Equal([]types.Hash{block.HeaderHash}, hashes)
+}
+
+// test that records written under the legacy, untagged key scheme are
+// migrated to the tagged schema on open
+func TestBlockStore_MigrateLegacySchema(t *testing.T) {
+	assert := assert.New(t)
+	store := memorystore.NewMemDBStore()
+	block := mockBlock()
+	blockByte, err := encodeBlock(block)
+	assert.Nil(err)
+	assert.Nil(store.Put(util.HashToBytes(block.HeaderHash), blockByte))
+	assert.Nil(store.Put(encodeBlockHeight(block.Header.Height), util.HashToBytes(block.HeaderHash)))
+	assert.Nil(store.Put([]byte(latestBlockKey), util.HashToBytes(block.HeaderHash)))
+
+	blockCache, headerCache, err := newCaches(0, 0)
+	assert.Nil(err)
+	blockStore := &BlockStore{store: store, codec: jsonBlockCodec{}, blockCache: blockCache, headerCache: headerCache}
+	blockStore.migrateLegacySchema()
+	blockStore.loadLatestBlock()
+
+	blockSaved, err := blockStore.GetBlockByHash(block.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(block.HeaderHash, blockSaved.HeaderHash)
+	current := blockStore.GetCurrentBlock()
+	assert.Equal(block.HeaderHash, current.HeaderHash)
+
+	headerSaved, err := blockStore.GetHeaderByHash(block.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(block.Header.Height, headerSaved.Height)
+
+	// running the migration again should be a no-op since schemaVersion is now set
+	blockStore.migrateLegacySchema()
+	_, err = store.Get(legacyLatestBlockKey)
+	assert.NotNil(err)
+}
+
+// test that migrating legacy (always-JSON) records into a store opened with
+// a non-JSON codec re-encodes them, rather than leaving raw JSON bytes
+// behind a codec that can't decode them
+func TestBlockStore_MigrateLegacySchema_NonJSONCodec(t *testing.T) {
+	assert := assert.New(t)
+	store := memorystore.NewMemDBStore()
+	block := mockBlock()
+	blockByte, err := encodeBlock(block)
+	assert.Nil(err)
+	assert.Nil(store.Put(util.HashToBytes(block.HeaderHash), blockByte))
+	assert.Nil(store.Put(encodeBlockHeight(block.Header.Height), util.HashToBytes(block.HeaderHash)))
+	assert.Nil(store.Put([]byte(latestBlockKey), util.HashToBytes(block.HeaderHash)))
+
+	blockCache, headerCache, err := newCaches(0, 0)
+	assert.Nil(err)
+	blockStore := &BlockStore{store: store, codec: cborBlockCodec{}, blockCache: blockCache, headerCache: headerCache}
+	blockStore.migrateLegacySchema()
+	blockStore.loadLatestBlock()
+
+	blockSaved, err := blockStore.GetBlockByHash(block.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(block.HeaderHash, blockSaved.HeaderHash)
+}
+
+// test that each supported codec can round-trip a block
+func TestNewBlockCodec_RoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	block := mockBlock()
+	for _, name := range []string{"", CODEC_JSON, CODEC_CBOR} {
+		codec, err := newBlockCodec(name)
+		assert.Nil(err)
+		encoded, err := codec.Encode(block)
+		assert.Nil(err)
+		decoded, err := codec.Decode(encoded)
+		assert.Nil(err)
+		assert.Equal(block.HeaderHash, decoded.HeaderHash)
+	}
+}
+
+// test that selecting an unknown codec name fails
+func TestNewBlockCodec_Unsupported(t *testing.T) {
+	assert := assert.New(t)
+	_, err := newBlockCodec("xml")
+	assert.NotNil(err)
+}
+
+// test that reopening a store with a different codec than it was created with fails
+func TestBlockStore_CodecMismatch(t *testing.T) {
+	assert := assert.New(t)
+	blockStoreConfig := mockBlockStoreConfig()
+	store, err := createDBStore(blockStoreConfig)
+	assert.Nil(err)
+	assert.Nil(store.Put(metaCodecKey, []byte(CODEC_CBOR)))
+
+	blockStoreConfig.Codec = CODEC_JSON
+	blockStore := &BlockStore{store: store, codec: jsonBlockCodec{}}
+	err = blockStore.checkCodec()
+	assert.NotNil(err)
+}
+
+// test looking up a transaction by hash via the tx-lookup index
+func TestBlockStore_GetTransactionByHash(t *testing.T) {
+	assert := assert.New(t)
+	blockStoreConfig := mockBlockStoreConfig()
+	blockStoreConfig.EnableTxIndex = true
+	blockStore, err := NewBlockStore(blockStoreConfig)
+	assert.Nil(err)
+	assert.NotNil(blockStore)
+
+	block := mockBlockWithTransaction()
+	assert.Nil(blockStore.WriteBlock(block))
+
+	tx, blockHashFound, height, index, err := blockStore.GetTransactionByHash(txHash)
+	assert.Nil(err)
+	assert.Equal(txHash, tx.Hash.Load())
+	assert.Equal(block.HeaderHash, blockHashFound)
+	assert.Equal(block.Header.Height, height)
+	assert.Equal(uint64(0), index)
+
+	assert.Nil(blockStore.DeleteBlock(block.HeaderHash))
+	_, _, _, _, err = blockStore.GetTransactionByHash(txHash)
+	assert.NotNil(err)
+}
+
+// test that GetTransactionByHash fails cleanly when the tx index is disabled
+func TestBlockStore_GetTransactionByHash_IndexDisabled(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(err)
+	assert.NotNil(blockStore)
+
+	block := mockBlockWithTransaction()
+	assert.Nil(blockStore.WriteBlock(block))
+
+	_, _, _, _, err = blockStore.GetTransactionByHash(txHash)
+	assert.NotNil(err)
+}
+
+// test rebuilding the tx-lookup index from existing blocks
+func TestBlockStore_ReindexTransactions(t *testing.T) {
+	assert := assert.New(t)
+	blockStoreConfig := mockBlockStoreConfig()
+	blockStoreConfig.EnableTxIndex = true
+	blockStore, err := NewBlockStore(blockStoreConfig)
+	assert.Nil(err)
+	assert.NotNil(blockStore)
+
+	block := mockBlockWithTransaction()
+	assert.Nil(blockStore.WriteBlock(block))
+
+	err = blockStore.ReindexTransactions()
+	assert.Nil(err)
+	tx, _, _, _, err := blockStore.GetTransactionByHash(txHash)
+	assert.Nil(err)
+	assert.Equal(txHash, tx.Hash.Load())
+}
+
+// test fetching a header without decoding the full block body
+func TestBlockStore_GetHeaderByHash(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(err)
+	assert.NotNil(blockStore)
+
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+
+	header, err := blockStore.GetHeaderByHash(block.HeaderHash)
+	assert.Nil(err)
+	assert.Equal(block.Header.Height, header.Height)
+
+	headerByHeight, err := blockStore.GetHeaderByHeight(block.Header.Height)
+	assert.Nil(err)
+	assert.Equal(block.Header.Height, headerByHeight.Height)
+}
+
+// test that repeated reads hit the in-memory block cache
+func TestBlockStore_Stats(t *testing.T) {
+	assert := assert.New(t)
+	blockStore, err := NewBlockStore(mockBlockStoreConfig())
+	assert.Nil(err)
+	assert.NotNil(blockStore)
+
+	block := mockBlock()
+	assert.Nil(blockStore.WriteBlock(block))
+
+	_, err = blockStore.GetBlockByHash(block.HeaderHash)
+	assert.Nil(err)
+	_, err = blockStore.GetBlockByHash(block.HeaderHash)
+	assert.Nil(err)
+
+	stats := blockStore.Stats()
+	assert.True(stats.BlockCacheHits >= 1)
+}
+
 // test load latest block from database
 func TestBlockStore_LoadLatestBlock(t *testing.T) {
 	assert := assert.New(t)
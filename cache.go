@@ -0,0 +1,114 @@
+package blockstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/util"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+)
+
+// defaultBlockCacheSize and defaultHeaderCacheSize are used whenever the
+// corresponding config field is left unset.
+const (
+	defaultBlockCacheSize  = 512
+	defaultHeaderCacheSize = 2048
+)
+
+// Stats reports the in-memory cache hit/miss counters maintained by
+// BlockStore's block and header caches.
+type Stats struct {
+	BlockCacheHits    uint64
+	BlockCacheMisses  uint64
+	HeaderCacheHits   uint64
+	HeaderCacheMisses uint64
+}
+
+// Stats returns a snapshot of the current block/header cache hit and miss counters.
+func (blockStore *BlockStore) Stats() Stats {
+	return Stats{
+		BlockCacheHits:    atomic.LoadUint64(&blockStore.blockCacheHits),
+		BlockCacheMisses:  atomic.LoadUint64(&blockStore.blockCacheMisses),
+		HeaderCacheHits:   atomic.LoadUint64(&blockStore.headerCacheHits),
+		HeaderCacheMisses: atomic.LoadUint64(&blockStore.headerCacheMisses),
+	}
+}
+
+// newCaches builds the block and header LRU caches for a BlockStore,
+// applying the default sizes when the config leaves either one unset.
+func newCaches(blockCacheSize, headerCacheSize int) (*lru.Cache, *lru.Cache, error) {
+	if blockCacheSize <= 0 {
+		blockCacheSize = defaultBlockCacheSize
+	}
+	if headerCacheSize <= 0 {
+		headerCacheSize = defaultHeaderCacheSize
+	}
+	blockCache, err := lru.New(blockCacheSize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create block cache, as: %v ", err)
+	}
+	headerCache, err := lru.New(headerCacheSize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create header cache, as: %v ", err)
+	}
+	return blockCache, headerCache, nil
+}
+
+// invalidateCaches drops any cached block/header entry for hash, called
+// whenever the backing record for hash changes or is removed.
+func (blockStore *BlockStore) invalidateCaches(hash types.Hash) {
+	blockStore.blockCache.Remove(hash)
+	blockStore.headerCache.Remove(hash)
+}
+
+// GetHeaderByHash returns only the header for the block identified by hash,
+// so callers that don't need the full body never pay to decode it.
+func (blockStore *BlockStore) GetHeaderByHash(hash types.Hash) (*types.Header, error) {
+	blockStore.lock.RLock()
+	defer blockStore.lock.RUnlock()
+
+	if cached, ok := blockStore.headerCache.Get(hash); ok {
+		atomic.AddUint64(&blockStore.headerCacheHits, 1)
+		return cached.(*types.Header), nil
+	}
+	atomic.AddUint64(&blockStore.headerCacheMisses, 1)
+
+	headerByte, err := blockStore.store.Get(blockHeaderKey(util.HashToBytes(hash)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get header with hash %s, as: %v ", hash, err)
+	}
+	header := &types.Header{}
+	if err := json.Unmarshal(headerByte, header); err != nil {
+		return nil, fmt.Errorf("failed to decode header with hash %s, as: %v ", hash, err)
+	}
+	blockStore.headerCache.Add(hash, header)
+	return header, nil
+}
+
+// GetHeaderByHeight returns the header of the canonical block at height,
+// following the same "most recently written wins" rule as GetBlockByHeight.
+func (blockStore *BlockStore) GetHeaderByHeight(height uint64) (*types.Header, error) {
+	hashes, err := blockStore.GetBlockHashesByHeight(height)
+	if err != nil || len(hashes) == 0 {
+		return nil, fmt.Errorf("failed to get header with height %d, as: %v ", height, err)
+	}
+	return blockStore.GetHeaderByHash(hashes[len(hashes)-1])
+}
+
+// stageHeaderNoLock stages block.Header under its own key prefix so header
+// reads never need to decode the full block payload. Callers must hold
+// blockStore.lock.
+func (blockStore *BlockStore) stageHeaderNoLock(batch common.WriteBatch, block *types.Block) error {
+	headerByte, err := json.Marshal(block.Header)
+	if err != nil {
+		log.Error("Failed to encode header of block %v, as: %v ", block, err)
+		return fmt.Errorf("failed to encode header of block %v, as: %v ", block, err)
+	}
+	batch.Put(blockHeaderKey(util.HashToBytes(common.BlockHash(block))), headerByte)
+	return nil
+}
@@ -0,0 +1,78 @@
+package blockstore
+
+import (
+	"fmt"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	// CODEC_JSON encodes blocks with encoding/json. Default, kept for
+	// backwards compatibility with stores created before codecs existed.
+	CODEC_JSON = "json"
+	// CODEC_CBOR encodes blocks with CBOR, a compact binary JSON superset.
+	CODEC_CBOR = "cbor"
+)
+
+// metaCodecKey records which codec a store was created with, so opening it
+// later with a different codec fails cleanly instead of silently producing
+// garbage decodes.
+var metaCodecKey = metaKey("codec")
+
+// BlockCodec encodes and decodes the block payload persisted by BlockStore.
+type BlockCodec interface {
+	Encode(block *types.Block) ([]byte, error)
+	Decode(data []byte) (*types.Block, error)
+}
+
+// newBlockCodec returns the BlockCodec registered under name, defaulting to
+// the JSON codec when name is empty.
+func newBlockCodec(name string) (BlockCodec, error) {
+	switch name {
+	case "", CODEC_JSON:
+		return jsonBlockCodec{}, nil
+	case CODEC_CBOR:
+		return cborBlockCodec{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported block codec %q", name)
+	}
+}
+
+// codecNameOf returns the config name a codec instance was constructed from,
+// the inverse of newBlockCodec, used to persist and verify the active codec.
+func codecNameOf(codec BlockCodec) string {
+	switch codec.(type) {
+	case cborBlockCodec:
+		return CODEC_CBOR
+	default:
+		return CODEC_JSON
+	}
+}
+
+// jsonBlockCodec is the original, human-readable codec.
+type jsonBlockCodec struct{}
+
+func (jsonBlockCodec) Encode(block *types.Block) ([]byte, error) {
+	return encodeBlock(block)
+}
+
+func (jsonBlockCodec) Decode(data []byte) (*types.Block, error) {
+	return decodeBlock(data)
+}
+
+// cborBlockCodec encodes blocks with CBOR, smaller and faster to parse than
+// JSON while still requiring no codegen.
+type cborBlockCodec struct{}
+
+func (cborBlockCodec) Encode(block *types.Block) ([]byte, error) {
+	return cbor.Marshal(block)
+}
+
+func (cborBlockCodec) Decode(data []byte) (*types.Block, error) {
+	block := &types.Block{}
+	if err := cbor.Unmarshal(data, block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
@@ -0,0 +1,44 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/DSiSc/craft/types"
+)
+
+// BlockHash returns the canonical hash identifying the given block.
+func BlockHash(block *types.Block) types.Hash {
+	return block.HeaderHash
+}
+
+// TxHash returns the canonical hash identifying the given transaction.
+// types.Transaction.Hash is a lazily-populated cache (an atomic.Value, not a
+// plain field) that the caller is expected to have already computed and
+// stored before handing the transaction to the block store; craft/types
+// itself provides no way to derive the hash from scratch. An unpopulated
+// cache is reported as an error rather than silently indexing a zero hash.
+func TxHash(tx *types.Transaction) (types.Hash, error) {
+	hash, ok := tx.Hash.Load().(types.Hash)
+	if !ok {
+		return types.Hash{}, fmt.Errorf("transaction hash has not been computed")
+	}
+	return hash, nil
+}
+
+// WriteBatch stages a group of Put/Delete operations so a DBStore
+// implementation can commit them as a single atomic write. It lives in this
+// shared package, rather than in blockstore or a specific store plugin, so
+// that both sides of the DBStore contract can refer to the same type
+// without an import cycle.
+type WriteBatch interface {
+	// Put stages a key/value write.
+	Put(key []byte, value []byte)
+	// Delete stages a key removal.
+	Delete(key []byte)
+	// Write commits all staged operations atomically.
+	Write() error
+	// Reset clears all staged operations so the batch can be reused.
+	Reset()
+	// Close releases any resource held by the batch.
+	Close()
+}
@@ -0,0 +1,30 @@
+package config
+
+// BlockStoreConfig is the configuration used to create a BlockStore instance.
+type BlockStoreConfig struct {
+	// PluginName selects which DBStore implementation backs the block store.
+	PluginName string
+	// DataPath is the on-disk location used by file-based plugins.
+	DataPath string
+	// Codec selects the BlockCodec used to encode/decode stored blocks
+	// ("json" or "cbor"). Defaults to "json" when empty.
+	Codec string
+	// EnableTxIndex turns on the transaction lookup index, which roughly
+	// doubles write volume but allows GetTransactionByHash to avoid a full scan.
+	EnableTxIndex bool
+	// BlockCacheSize is the number of full blocks kept in the in-memory LRU
+	// cache in front of the store. Defaults to 512 when <= 0.
+	BlockCacheSize int
+	// HeaderCacheSize is the number of block headers kept in the in-memory
+	// LRU cache in front of the store. Defaults to 2048 when <= 0.
+	HeaderCacheSize int
+	// PebbleCacheSize is the size, in bytes, of the pebble block cache.
+	// Only used by the pebble plugin. Defaults to 8MiB when <= 0.
+	PebbleCacheSize int64
+	// PebbleMaxOpenFiles caps the number of file descriptors pebble may hold
+	// open at once. Only used by the pebble plugin. Defaults to 1000 when <= 0.
+	PebbleMaxOpenFiles int
+	// PebbleWALSync enables synchronous WAL writes for the pebble plugin,
+	// trading write throughput for durability on crash.
+	PebbleWALSync bool
+}
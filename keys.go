@@ -0,0 +1,64 @@
+package blockstore
+
+// Key schema: every stored key is a single-byte type tag, a ':' separator,
+// and a type-specific binary key. This keeps unrelated record types (a block
+// hash, a block height, a meta name, ...) from ever colliding in the same
+// keyspace, which the old ad-hoc scheme (bare hash, bare height, bare
+// "LatestBlock" string) could not guarantee.
+const (
+	keyTagBlockBody   byte = 0x01
+	keyTagBlockHeader byte = 0x02
+	keyTagHeightIndex byte = 0x03
+	keyTagTxLookup    byte = 0x04
+	keyTagMeta        byte = 0x05
+)
+
+const keyTagSeparator = ':'
+
+// schemaVersion is the current on-disk key schema version. Bump this and
+// extend migrateLegacySchema whenever the schema changes in an
+// incompatible way.
+const schemaVersion = 1
+
+// metaSchemaVersionKey records which schema version a store was last
+// migrated to, so migrateLegacySchema in block_store.go runs at most once.
+var metaSchemaVersionKey = metaKey("schemaVersion")
+
+// legacyLatestBlockKey is the bare, untagged key the old schema used to
+// track the current tip.
+var legacyLatestBlockKey = []byte(latestBlockKey)
+
+// makeKey builds a tagged key by prefixing key with tag and a separator.
+func makeKey(tag byte, key []byte) []byte {
+	tagged := make([]byte, 0, len(key)+2)
+	tagged = append(tagged, tag, keyTagSeparator)
+	tagged = append(tagged, key...)
+	return tagged
+}
+
+// blockBodyKey returns the tagged key under which a block's JSON/CBOR/etc
+// payload is stored.
+func blockBodyKey(hashBytes []byte) []byte {
+	return makeKey(keyTagBlockBody, hashBytes)
+}
+
+// blockHeaderKey returns the tagged key under which a block's header alone
+// is stored, so header-only readers never pay to decode the full body.
+func blockHeaderKey(hashBytes []byte) []byte {
+	return makeKey(keyTagBlockHeader, hashBytes)
+}
+
+// heightIndexKey returns the tagged key for the height -> candidate hashes index.
+func heightIndexKey(height uint64) []byte {
+	return makeKey(keyTagHeightIndex, encodeBlockHeight(height))
+}
+
+// metaKey returns the tagged key for a named meta record, e.g. the latest
+// block pointer or the schema version.
+func metaKey(name string) []byte {
+	return makeKey(keyTagMeta, []byte(name))
+}
+
+// latestBlockMetaKey is the tagged replacement for the legacy bare
+// latestBlockKey.
+var latestBlockMetaKey = metaKey(latestBlockKey)
@@ -0,0 +1,80 @@
+package leveldbstore
+
+import (
+	"github.com/DSiSc/blockstore/common"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// LevelDBStore is a file-based implementation of blockstore.DBStore backed by goleveldb.
+type LevelDBStore struct {
+	db *leveldb.DB
+}
+
+// NewLevelDBStore opens (creating if necessary) a leveldb database at path.
+func NewLevelDBStore(path string) (*LevelDBStore, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &LevelDBStore{db: db}, nil
+}
+
+// Put stores value under key, overwriting any existing value.
+func (store *LevelDBStore) Put(key []byte, value []byte) error {
+	return store.db.Put(key, value, nil)
+}
+
+// Get returns the value stored under key.
+func (store *LevelDBStore) Get(key []byte) ([]byte, error) {
+	return store.db.Get(key, nil)
+}
+
+// Delete removes the value stored under key, if any.
+func (store *LevelDBStore) Delete(key []byte) error {
+	return store.db.Delete(key, nil)
+}
+
+// Close releases the underlying database handle.
+func (store *LevelDBStore) Close() error {
+	return store.db.Close()
+}
+
+// NewBatch returns a WriteBatch backed by a leveldb.Batch.
+func (store *LevelDBStore) NewBatch() common.WriteBatch {
+	return &levelDBBatch{
+		db:    store.db,
+		batch: new(leveldb.Batch),
+	}
+}
+
+// levelDBBatch implements blockstore.WriteBatch on top of leveldb.Batch.
+type levelDBBatch struct {
+	db    *leveldb.DB
+	batch *leveldb.Batch
+}
+
+// Put stages a key/value write.
+func (b *levelDBBatch) Put(key []byte, value []byte) {
+	b.batch.Put(key, value)
+}
+
+// Delete stages a key removal.
+func (b *levelDBBatch) Delete(key []byte) {
+	b.batch.Delete(key)
+}
+
+// Write commits all staged operations atomically.
+func (b *levelDBBatch) Write() error {
+	return b.db.Write(b.batch, nil)
+}
+
+// Reset clears all staged operations so the batch can be reused.
+func (b *levelDBBatch) Reset() {
+	b.batch.Reset()
+}
+
+// Close releases the batch. leveldb.Batch holds no external resources, so
+// this only drops references to help the GC.
+func (b *levelDBBatch) Close() {
+	b.batch = nil
+}
@@ -0,0 +1,103 @@
+package memorystore
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/DSiSc/blockstore/common"
+)
+
+// MemDBStore is an in-memory, map-backed implementation of blockstore.DBStore.
+// It is primarily intended for tests and other scenarios where persistence
+// across process restarts is not required.
+type MemDBStore struct {
+	lock sync.RWMutex
+	data map[string][]byte
+}
+
+// NewMemDBStore creates a new, empty in-memory store.
+func NewMemDBStore() *MemDBStore {
+	return &MemDBStore{
+		data: make(map[string][]byte),
+	}
+}
+
+// Put stores value under key, overwriting any existing value.
+func (store *MemDBStore) Put(key []byte, value []byte) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.data[string(key)] = value
+	return nil
+}
+
+// Get returns the value stored under key, or an error if it does not exist.
+func (store *MemDBStore) Get(key []byte) ([]byte, error) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	value, ok := store.data[string(key)]
+	if !ok {
+		return nil, fmt.Errorf("key %x not found", key)
+	}
+	return value, nil
+}
+
+// Delete removes the value stored under key, if any.
+func (store *MemDBStore) Delete(key []byte) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	delete(store.data, string(key))
+	return nil
+}
+
+// NewBatch returns a WriteBatch that buffers operations until Write is called.
+func (store *MemDBStore) NewBatch() common.WriteBatch {
+	return &memDBBatch{store: store}
+}
+
+// memDBOp is a single staged Put (isDel == false) or Delete (isDel == true) operation.
+type memDBOp struct {
+	key   string
+	value []byte
+	isDel bool
+}
+
+// memDBBatch buffers operations against a MemDBStore and applies them all
+// under a single lock acquisition when Write is called.
+type memDBBatch struct {
+	store *MemDBStore
+	ops   []memDBOp
+}
+
+// Put stages a key/value write.
+func (b *memDBBatch) Put(key []byte, value []byte) {
+	b.ops = append(b.ops, memDBOp{key: string(key), value: value})
+}
+
+// Delete stages a key removal.
+func (b *memDBBatch) Delete(key []byte) {
+	b.ops = append(b.ops, memDBOp{key: string(key), isDel: true})
+}
+
+// Write commits all staged operations atomically.
+func (b *memDBBatch) Write() error {
+	b.store.lock.Lock()
+	defer b.store.lock.Unlock()
+	for _, op := range b.ops {
+		if op.isDel {
+			delete(b.store.data, op.key)
+		} else {
+			b.store.data[op.key] = op.value
+		}
+	}
+	return nil
+}
+
+// Reset clears all staged operations so the batch can be reused.
+func (b *memDBBatch) Reset() {
+	b.ops = b.ops[:0]
+}
+
+// Close releases the batch's staged operations.
+func (b *memDBBatch) Close() {
+	b.ops = nil
+}
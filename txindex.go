@@ -0,0 +1,119 @@
+package blockstore
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/DSiSc/blockstore/common"
+	"github.com/DSiSc/blockstore/util"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+)
+
+// txLookupKey returns the tagged key the tx-lookup index is stored under.
+func txLookupKey(txHashBytes []byte) []byte {
+	return makeKey(keyTagTxLookup, txHashBytes)
+}
+
+// txLookupEntry records where a transaction can be found: the block that
+// contains it and its index within that block's transaction list.
+type txLookupEntry struct {
+	BlockHash types.Hash
+	Index     uint64
+}
+
+// stageTxIndexNoLock stages a txHash -> (blockHash, index) entry for every
+// transaction in block. Callers must hold blockStore.lock.
+func (blockStore *BlockStore) stageTxIndexNoLock(batch common.WriteBatch, block *types.Block) error {
+	blockHash := common.BlockHash(block)
+	for index, tx := range block.Transactions {
+		txHash, err := common.TxHash(tx)
+		if err != nil {
+			return fmt.Errorf("failed to stage tx-lookup entry for tx %d in block %s, as: %v ", index, blockHash, err)
+		}
+		entry := txLookupEntry{BlockHash: blockHash, Index: uint64(index)}
+		entryByte, err := json.Marshal(entry)
+		if err != nil {
+			log.Error("Failed to encode tx-lookup entry for tx %s, as: %v ", txHash, err)
+			return fmt.Errorf("failed to encode tx-lookup entry for tx %s, as: %v ", txHash, err)
+		}
+		batch.Put(txLookupKey(util.HashToBytes(txHash)), entryByte)
+	}
+	return nil
+}
+
+// unstageTxIndexNoLock stages the removal of every tx-lookup entry for the
+// transactions in block. Callers must hold blockStore.lock.
+func (blockStore *BlockStore) unstageTxIndexNoLock(batch common.WriteBatch, block *types.Block) {
+	for index, tx := range block.Transactions {
+		txHash, err := common.TxHash(tx)
+		if err != nil {
+			log.Warn("Failed to unstage tx-lookup entry for tx %d in block %s, as: %v ", index, common.BlockHash(block), err)
+			continue
+		}
+		batch.Delete(txLookupKey(util.HashToBytes(txHash)))
+	}
+}
+
+// GetTransactionByHash returns the transaction identified by txHash, along
+// with the hash and height of the block containing it and its index within
+// that block. It requires BlockStoreConfig.EnableTxIndex.
+func (blockStore *BlockStore) GetTransactionByHash(txHash types.Hash) (*types.Transaction, types.Hash, uint64, uint64, error) {
+	if !blockStore.txIndexEnabled {
+		return nil, types.Hash{}, 0, 0, fmt.Errorf("tx index is not enabled")
+	}
+
+	entryByte, err := blockStore.store.Get(txLookupKey(util.HashToBytes(txHash)))
+	if err != nil {
+		return nil, types.Hash{}, 0, 0, fmt.Errorf("failed to get tx-lookup entry for tx %s, as: %v ", txHash, err)
+	}
+	var entry txLookupEntry
+	if err := json.Unmarshal(entryByte, &entry); err != nil {
+		return nil, types.Hash{}, 0, 0, fmt.Errorf("failed to decode tx-lookup entry for tx %s, as: %v ", txHash, err)
+	}
+
+	block, err := blockStore.GetBlockByHash(entry.BlockHash)
+	if err != nil {
+		return nil, types.Hash{}, 0, 0, fmt.Errorf("failed to get block %s containing tx %s, as: %v ", entry.BlockHash, txHash, err)
+	}
+	if entry.Index >= uint64(len(block.Transactions)) {
+		return nil, types.Hash{}, 0, 0, fmt.Errorf("tx-lookup entry for tx %s points past the end of block %s", txHash, entry.BlockHash)
+	}
+	return block.Transactions[entry.Index], entry.BlockHash, block.Header.Height, entry.Index, nil
+}
+
+// ReindexTransactions rebuilds the tx-lookup index from every block
+// currently reachable by height, e.g. after enabling EnableTxIndex on a
+// store that already has blocks.
+func (blockStore *BlockStore) ReindexTransactions() error {
+	if !blockStore.txIndexEnabled {
+		return fmt.Errorf("tx index is not enabled")
+	}
+
+	currentHeight := blockStore.GetCurrentBlockHeight()
+	for height := uint64(INIT_BLOCK_HEIGHT); height <= currentHeight; height++ {
+		hashes, err := blockStore.GetBlockHashesByHeight(height)
+		if err != nil {
+			continue
+		}
+		for _, hash := range hashes {
+			block, err := blockStore.GetBlockByHash(hash)
+			if err != nil {
+				log.Warn("Failed to load block %s while reindexing transactions, as: %v ", hash, err)
+				continue
+			}
+			blockStore.lock.Lock()
+			batch := blockStore.store.NewBatch()
+			err = blockStore.stageTxIndexNoLock(batch, block)
+			if err == nil {
+				err = batch.Write()
+			}
+			batch.Close()
+			blockStore.lock.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
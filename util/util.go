@@ -0,0 +1,27 @@
+package util
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/DSiSc/craft/types"
+)
+
+// HashToBytes converts a types.Hash to its raw byte representation.
+func HashToBytes(hash types.Hash) []byte {
+	return hash[:]
+}
+
+// BytesToHash converts raw bytes back into a types.Hash.
+func BytesToHash(b []byte) types.Hash {
+	var hash types.Hash
+	copy(hash[:], b)
+	return hash
+}
+
+// HexToHash converts a hex encoded string (with an optional "0x" prefix) to a types.Hash.
+func HexToHash(s string) types.Hash {
+	s = strings.TrimPrefix(s, "0x")
+	b, _ := hex.DecodeString(s)
+	return BytesToHash(b)
+}